@@ -0,0 +1,427 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	flaggerv1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// OTelExporterProtocol selects the OTLP transport used to ship metrics to the
+// configured collector endpoint.
+type OTelExporterProtocol string
+
+const (
+	OTelExporterGRPC OTelExporterProtocol = "grpc"
+	OTelExporterHTTP OTelExporterProtocol = "http"
+)
+
+// OTelConfig holds the settings needed to wire Flagger's metrics to an
+// OpenTelemetry Collector. It is passed to NewOTelRecorder by the caller;
+// this package defines no command-line flags for it.
+type OTelConfig struct {
+	// Endpoint is the OTLP collector address, e.g. "otel-collector:4317".
+	Endpoint string
+	// Protocol is either OTelExporterGRPC or OTelExporterHTTP.
+	Protocol OTelExporterProtocol
+	// Insecure disables TLS on the OTLP connection.
+	Insecure bool
+}
+
+// OTelRecorder records the canary analysis as OpenTelemetry metrics. It mirrors
+// the subsystem/label semantics of Recorder so that dashboards built for the
+// Prometheus exporter can be migrated to an OTel Collector backend 1:1.
+type OTelRecorder struct {
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+
+	info                          instrument.Int64ObservableGauge
+	duration                      instrument.Float64Histogram
+	total                         instrument.Int64ObservableGauge
+	status                        instrument.Int64ObservableGauge
+	phase                         instrument.Int64ObservableGauge
+	webhookConfirmRollout         instrument.Int64ObservableGauge
+	webhookConfirmTrafficIncrease instrument.Int64ObservableGauge
+	webhookConfirmPromotion       instrument.Int64ObservableGauge
+	weight                        instrument.Int64ObservableGauge
+	iterations                    instrument.Int64Counter
+	metricCheck                   instrument.Int64Counter
+	rollback                      instrument.Int64Counter
+
+	config RecorderConfig
+
+	mu     sync.Mutex
+	values map[gaugeID]map[string]observation
+}
+
+// gaugeID identifies one of the Int64ObservableGauge instruments in the
+// values cache. Instruments are interface-wrapped structs, not pointers, so
+// they can't be stringified with %p for use as a map key.
+type gaugeID int
+
+const (
+	gaugeInfo gaugeID = iota
+	gaugeTotal
+	gaugeStatus
+	gaugePhase
+	gaugeWebhookConfirmRollout
+	gaugeWebhookConfirmTrafficIncrease
+	gaugeWebhookConfirmPromotion
+	gaugeWeight
+)
+
+// observation is the last value recorded for one attribute set of one gauge.
+// OTel gauges are pulled at export time rather than pushed, so SetX calls
+// cache the latest point here and the registered callback replays it.
+type observation struct {
+	attrs []attribute.KeyValue
+	value int64
+}
+
+// NewOTelRecorder creates a new recorder and exports through an OTLP exporter.
+func NewOTelRecorder(controller string, cfg OTelConfig, config ...RecorderConfig) (*OTelRecorder, error) {
+	ctx := context.Background()
+
+	var recorderCfg RecorderConfig
+	if len(config) > 0 {
+		recorderCfg = config[0]
+	}
+	if err := recorderCfg.validate(); err != nil {
+		return nil, err
+	}
+
+	exporter, err := newOTLPExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+	)
+	meter := provider.Meter(fmt.Sprintf("flagger/%s", controller))
+
+	cr := &OTelRecorder{
+		provider: provider,
+		meter:    meter,
+		config:   recorderCfg,
+		values:   make(map[gaugeID]map[string]observation),
+	}
+
+	if err := cr.registerInstruments(controller); err != nil {
+		return nil, fmt.Errorf("registering OTel instruments: %w", err)
+	}
+
+	return cr, nil
+}
+
+func newOTLPExporter(ctx context.Context, cfg OTelConfig) (sdkmetric.Exporter, error) {
+	switch cfg.Protocol {
+	case OTelExporterHTTP:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	case OTelExporterGRPC, "":
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTel exporter protocol %q", cfg.Protocol)
+	}
+}
+
+// registerInstruments creates the Int64ObservableGauge/Float64Histogram
+// instruments and the single callback that feeds them from the last value
+// recorded for each label set, since OTel gauges are observed on export
+// rather than pushed like their Prometheus counterparts.
+func (cr *OTelRecorder) registerInstruments(controller string) error {
+	name := func(metricName string) string { return fmt.Sprintf("%s_%s", controller, metricName) }
+
+	var err error
+	if cr.info, err = cr.meter.Int64ObservableGauge(name("info"),
+		instrument.WithDescription("Flagger version and mesh provider information")); err != nil {
+		return err
+	}
+	if cr.duration, err = cr.meter.Float64Histogram(name("canary_duration_seconds"),
+		instrument.WithDescription("Seconds spent performing canary analysis.")); err != nil {
+		return err
+	}
+	if cr.total, err = cr.meter.Int64ObservableGauge(name("canary_total"),
+		instrument.WithDescription("Total number of canary object")); err != nil {
+		return err
+	}
+	if cr.status, err = cr.meter.Int64ObservableGauge(name("canary_status"),
+		instrument.WithDescription("Last canary analysis result")); err != nil {
+		return err
+	}
+	if cr.phase, err = cr.meter.Int64ObservableGauge(name("canary_phase"),
+		instrument.WithDescription("Condition of a canary at the current time")); err != nil {
+		return err
+	}
+	if cr.webhookConfirmRollout, err = cr.meter.Int64ObservableGauge(name("canary_webhook_confirm_rollout"),
+		instrument.WithDescription("greater than 0 if confirm_rollout webhook failed")); err != nil {
+		return err
+	}
+	if cr.webhookConfirmTrafficIncrease, err = cr.meter.Int64ObservableGauge(name("canary_webhook_confirm_traffic_increase"),
+		instrument.WithDescription("greater than 0 if confirm_traffic_increase webhook failed")); err != nil {
+		return err
+	}
+	if cr.webhookConfirmPromotion, err = cr.meter.Int64ObservableGauge(name("canary_webhook_confirm_promotion"),
+		instrument.WithDescription("greater than 0 if confirm_promotion webhook failed")); err != nil {
+		return err
+	}
+	if cr.weight, err = cr.meter.Int64ObservableGauge(name("canary_weight"),
+		instrument.WithDescription("The virtual service destination weight current value")); err != nil {
+		return err
+	}
+	if cr.iterations, err = cr.meter.Int64Counter(name("canary_iteration_total"),
+		instrument.WithDescription("Number of canary analysis iterations")); err != nil {
+		return err
+	}
+	if cr.metricCheck, err = cr.meter.Int64Counter(name("canary_metric_check"),
+		instrument.WithDescription("Outcome of each canary analysis metric check")); err != nil {
+		return err
+	}
+	if cr.rollback, err = cr.meter.Int64Counter(name("canary_rollback_total"),
+		instrument.WithDescription("Number of canary rollbacks, labeled by the reason they were triggered")); err != nil {
+		return err
+	}
+
+	gauges := map[gaugeID]instrument.Int64ObservableGauge{
+		gaugeInfo:                          cr.info,
+		gaugeTotal:                         cr.total,
+		gaugeStatus:                        cr.status,
+		gaugePhase:                         cr.phase,
+		gaugeWebhookConfirmRollout:         cr.webhookConfirmRollout,
+		gaugeWebhookConfirmTrafficIncrease: cr.webhookConfirmTrafficIncrease,
+		gaugeWebhookConfirmPromotion:       cr.webhookConfirmPromotion,
+		gaugeWeight:                        cr.weight,
+	}
+	observables := make([]instrument.Asynchronous, 0, len(gauges))
+	for _, g := range gauges {
+		observables = append(observables, g)
+	}
+
+	_, err = cr.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		cr.mu.Lock()
+		defer cr.mu.Unlock()
+		for id, g := range gauges {
+			for _, obs := range cr.values[id] {
+				o.ObserveInt64(g, obs.value, metric.WithAttributes(obs.attrs...))
+			}
+		}
+		return nil
+	}, observables...)
+	return err
+}
+
+// Shutdown flushes and stops the underlying MeterProvider. It should be
+// called when the controller exits.
+func (cr *OTelRecorder) Shutdown(ctx context.Context) error {
+	return cr.provider.Shutdown(ctx)
+}
+
+// canaryAttrs builds the attribute list for a per-canary instrument: the
+// given name/value pairs (sanitized against the configured allowlist)
+// followed by the static extra labels and the optional kind/provider labels.
+func (cr *OTelRecorder) canaryAttrs(cd *flaggerv1.Canary, names []string, values ...string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(values)+len(cr.config.ExtraLabels)+2)
+	for i, v := range values {
+		attrs = append(attrs, attribute.String(names[i], cr.config.sanitize(names[i], v)))
+	}
+	for _, name := range cr.config.extraLabelNames() {
+		attrs = append(attrs, attribute.String(name, cr.config.ExtraLabels[name]))
+	}
+	if cr.config.LabelTargetKind {
+		attrs = append(attrs, attribute.String("kind", cd.Spec.TargetRef.Kind))
+	}
+	if cr.config.LabelProvider {
+		attrs = append(attrs, attribute.String("provider", cd.Spec.Provider))
+	}
+	return attrs
+}
+
+// extraAttrs returns the static extra labels as attributes, for instruments
+// that don't carry a canary object (e.g. SetInfo, SetTotal).
+func (cr *OTelRecorder) extraAttrs() []attribute.KeyValue {
+	names := cr.config.extraLabelNames()
+	attrs := make([]attribute.KeyValue, len(names))
+	for i, name := range names {
+		attrs[i] = attribute.String(name, cr.config.ExtraLabels[name])
+	}
+	return attrs
+}
+
+func (cr *OTelRecorder) set(id gaugeID, value int64, attrs ...attribute.KeyValue) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.values[id] == nil {
+		cr.values[id] = make(map[string]observation)
+	}
+	cr.values[id][attribute.NewSet(attrs...).Encoded(attribute.DefaultEncoder())] = observation{attrs: attrs, value: value}
+}
+
+// SetInfo sets the version and mesh provider labels
+func (cr *OTelRecorder) SetInfo(version string, meshProvider string) {
+	attrs := append([]attribute.KeyValue{
+		attribute.String("version", version), attribute.String("mesh_provider", meshProvider),
+	}, cr.extraAttrs()...)
+	cr.set(gaugeInfo, 1, attrs...)
+}
+
+// SetDuration sets the time spent in seconds performing canary analysis
+func (cr *OTelRecorder) SetDuration(cd *flaggerv1.Canary, duration time.Duration) {
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.duration.Record(context.Background(), duration.Seconds(), attrs...)
+}
+
+// SetTotal sets the total number of canaries per namespace
+func (cr *OTelRecorder) SetTotal(namespace string, total int) {
+	attrs := append([]attribute.KeyValue{attribute.String("namespace", namespace)}, cr.extraAttrs()...)
+	cr.set(gaugeTotal, int64(total), attrs...)
+}
+
+// SetStatus sets the last known canary analysis status
+func (cr *OTelRecorder) SetStatus(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase) {
+	var status int64
+	switch phase {
+	case flaggerv1.CanaryPhaseProgressing:
+		status = 0
+	case flaggerv1.CanaryPhaseFailed:
+		status = 2
+	default:
+		status = 1
+	}
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugeStatus, status, attrs...)
+}
+
+// SetWebhookConfirmTrafficIncrease sets the webhook status
+func (cr *OTelRecorder) SetWebhookConfirmTrafficIncrease(cd *flaggerv1.Canary, status WebhookStatus) {
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugeWebhookConfirmTrafficIncrease, int64(status), attrs...)
+}
+
+// SetWebhookConfirmRollout sets the webhook status
+func (cr *OTelRecorder) SetWebhookConfirmRollout(cd *flaggerv1.Canary, status WebhookStatus) {
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugeWebhookConfirmRollout, int64(status), attrs...)
+}
+
+// SetWebhookConfirmPromotion sets the webhook status
+func (cr *OTelRecorder) SetWebhookConfirmPromotion(cd *flaggerv1.Canary, status WebhookStatus) {
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugeWebhookConfirmPromotion, int64(status), attrs...)
+}
+
+// SetPhase sets the last known condition of a canary at the current time
+func (cr *OTelRecorder) SetPhase(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase) {
+	type CanaryPhase int64
+	const (
+		Initializing     CanaryPhase = iota //0
+		Initialized                         //1
+		Waiting                             //2
+		Progressing                         //3
+		WaitingPromotion                    //4
+		Promoting                           //5
+		Finalising                          //6
+		Succeeded                           //7
+		Failed                              //8
+		Terminating                         //9
+		Terminated                          //10
+	)
+	var canaryPhase CanaryPhase
+	switch phase {
+	case flaggerv1.CanaryPhaseInitializing:
+		canaryPhase = Initializing
+	case flaggerv1.CanaryPhaseInitialized:
+		canaryPhase = Initialized
+	case flaggerv1.CanaryPhaseWaiting:
+		canaryPhase = Waiting
+	case flaggerv1.CanaryPhaseProgressing:
+		canaryPhase = Progressing
+	case flaggerv1.CanaryPhaseWaitingPromotion:
+		canaryPhase = WaitingPromotion
+	case flaggerv1.CanaryPhasePromoting:
+		canaryPhase = Promoting
+	case flaggerv1.CanaryPhaseFinalising:
+		canaryPhase = Finalising
+	case flaggerv1.CanaryPhaseSucceeded:
+		canaryPhase = Succeeded
+	case flaggerv1.CanaryPhaseFailed:
+		canaryPhase = Failed
+	case flaggerv1.CanaryPhaseTerminating:
+		canaryPhase = Terminating
+	case flaggerv1.CanaryPhaseTerminated:
+		canaryPhase = Terminated
+	default:
+		canaryPhase = Progressing
+	}
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugePhase, int64(canaryPhase), attrs...)
+}
+
+// SetWeight sets the weight values for primary and canary destinations
+func (cr *OTelRecorder) SetWeight(cd *flaggerv1.Canary, primary int, canary int) {
+	names := []string{"workload", "namespace"}
+	primaryAttrs := cr.canaryAttrs(cd, names, fmt.Sprintf("%s-primary", cd.Spec.TargetRef.Name), cd.Namespace)
+	cr.set(gaugeWeight, int64(primary), primaryAttrs...)
+	canaryAttrs := cr.canaryAttrs(cd, names, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.set(gaugeWeight, int64(canary), canaryAttrs...)
+}
+
+// IncCanaryIteration increments the number of analysis loops run for a
+// canary. Call once per pass of the canary controller's analysis loop.
+func (cr *OTelRecorder) IncCanaryIteration(cd *flaggerv1.Canary) {
+	attrs := cr.canaryAttrs(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.iterations.Add(context.Background(), 1, attrs...)
+}
+
+// IncMetricCheck records the outcome of a single metric-template check
+// performed during canary analysis. Call once per metric check the
+// canary controller runs, alongside the existing pass/fail decision.
+func (cr *OTelRecorder) IncMetricCheck(cd *flaggerv1.Canary, metricName string, pass bool) {
+	result := "pass"
+	if !pass {
+		result = "fail"
+	}
+	names := []string{"name", "namespace", "metric", "result"}
+	attrs := cr.canaryAttrs(cd, names, cd.Spec.TargetRef.Name, cd.Namespace, metricName, result)
+	cr.metricCheck.Add(context.Background(), 1, attrs...)
+}
+
+// IncRollback increments the number of rollbacks for a canary, labeled by
+// the reason the rollback was triggered. Call from the canary controller
+// wherever it currently transitions a canary to CanaryPhaseFailed.
+func (cr *OTelRecorder) IncRollback(cd *flaggerv1.Canary, reason RollbackReason) {
+	names := []string{"name", "namespace", "reason"}
+	attrs := cr.canaryAttrs(cd, names, cd.Spec.TargetRef.Name, cd.Namespace, string(reason))
+	cr.rollback.Add(context.Background(), 1, attrs...)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestOTelRecorderSetCachesByGaugeID(t *testing.T) {
+	cr := &OTelRecorder{values: make(map[gaugeID]map[string]observation)}
+
+	cr.set(gaugeTotal, 1, attribute.String("namespace", "a"))
+	cr.set(gaugeStatus, 2, attribute.String("namespace", "a"))
+
+	if len(cr.values[gaugeTotal]) != 1 || len(cr.values[gaugeStatus]) != 1 {
+		t.Fatalf("expected each gauge to keep its own observations, got %v", cr.values)
+	}
+	for _, obs := range cr.values[gaugeTotal] {
+		if obs.value != 1 {
+			t.Errorf("gaugeTotal value = %d, want 1", obs.value)
+		}
+	}
+	for _, obs := range cr.values[gaugeStatus] {
+		if obs.value != 2 {
+			t.Errorf("gaugeStatus value = %d, want 2", obs.value)
+		}
+	}
+}
+
+func TestOTelRecorderSetOverwritesSameAttributes(t *testing.T) {
+	cr := &OTelRecorder{values: make(map[gaugeID]map[string]observation)}
+
+	cr.set(gaugeWeight, 10, attribute.String("workload", "podinfo"), attribute.String("namespace", "test"))
+	cr.set(gaugeWeight, 90, attribute.String("workload", "podinfo"), attribute.String("namespace", "test"))
+
+	if len(cr.values[gaugeWeight]) != 1 {
+		t.Fatalf("expected one cached observation per attribute set, got %d", len(cr.values[gaugeWeight]))
+	}
+	for _, obs := range cr.values[gaugeWeight] {
+		if obs.value != 90 {
+			t.Errorf("cached value = %d, want latest value 90", obs.value)
+		}
+	}
+}
+
+func TestOTelRecorderExtraAttrsMatchConfiguredLabels(t *testing.T) {
+	cr := &OTelRecorder{config: RecorderConfig{ExtraLabels: map[string]string{"region": "eu", "cluster": "a"}}}
+
+	attrs := cr.extraAttrs()
+
+	if len(attrs) != 2 {
+		t.Fatalf("got %d attrs, want 2: %v", len(attrs), attrs)
+	}
+	if attrs[0].Key != "cluster" || attrs[1].Key != "region" {
+		t.Errorf("extraAttrs() = %v, want sorted by label name", attrs)
+	}
+}
+
+func TestOTelRecorderIncCounters(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	cr := &OTelRecorder{
+		provider: provider,
+		meter:    provider.Meter("test"),
+		values:   make(map[gaugeID]map[string]observation),
+	}
+	if err := cr.registerInstruments("test"); err != nil {
+		t.Fatalf("registerInstruments() = %v", err)
+	}
+
+	cd := testCanary()
+	cr.IncCanaryIteration(cd)
+	cr.IncMetricCheck(cd, "request-success-rate", true)
+	cr.IncRollback(cd, RollbackReasonWebhookFailed)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() = %v", err)
+	}
+
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					counts[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{"test_canary_iteration_total", "test_canary_metric_check", "test_canary_rollback_total"} {
+		if counts[name] != 1 {
+			t.Errorf("%s = %d, want 1", name, counts[name])
+		}
+	}
+}
@@ -24,6 +24,42 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Interface is implemented by the Flagger metrics backends. It decouples the
+// canary controller from the concrete telemetry system in use, so a Prometheus
+// based Recorder and an OpenTelemetry based OTelRecorder can be swapped without
+// changing call sites.
+type Interface interface {
+	SetInfo(version string, meshProvider string)
+	SetDuration(cd *flaggerv1.Canary, duration time.Duration)
+	SetTotal(namespace string, total int)
+	SetStatus(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase)
+	SetPhase(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase)
+	SetWeight(cd *flaggerv1.Canary, primary int, canary int)
+	SetWebhookConfirmRollout(cd *flaggerv1.Canary, status WebhookStatus)
+	SetWebhookConfirmTrafficIncrease(cd *flaggerv1.Canary, status WebhookStatus)
+	SetWebhookConfirmPromotion(cd *flaggerv1.Canary, status WebhookStatus)
+	IncCanaryIteration(cd *flaggerv1.Canary)
+	IncMetricCheck(cd *flaggerv1.Canary, metric string, pass bool)
+	IncRollback(cd *flaggerv1.Canary, reason RollbackReason)
+}
+
+var (
+	_ Interface = (*Recorder)(nil)
+	_ Interface = (*OTelRecorder)(nil)
+)
+
+// RollbackReason identifies why a canary analysis was aborted, so the
+// canary_rollback_total counter can be sliced by cause rather than just
+// counting failures.
+type RollbackReason string
+
+const (
+	RollbackReasonMetricCheckFailed RollbackReason = "metric_check_failed"
+	RollbackReasonWebhookFailed     RollbackReason = "webhook_failed"
+	RollbackReasonThresholdReached  RollbackReason = "threshold_reached"
+	RollbackReasonManual            RollbackReason = "manual"
+)
+
 // Recorder records the canary analysis as Prometheus metrics
 type Recorder struct {
 	info                          *prometheus.GaugeVec
@@ -35,6 +71,10 @@ type Recorder struct {
 	webhookConfirmTrafficIncrease *prometheus.GaugeVec
 	webhookConfirmPromotion       *prometheus.GaugeVec
 	weight                        *prometheus.GaugeVec
+	iterations                    *prometheus.CounterVec
+	metricCheck                   *prometheus.CounterVec
+	rollback                      *prometheus.CounterVec
+	config                        RecorderConfig
 }
 
 type WebhookStatus int
@@ -44,64 +84,88 @@ const (
 	WebhookStatusFailed
 )
 
-// NewRecorder creates a new recorder and registers the Prometheus metrics
-func NewRecorder(controller string, register bool) Recorder {
+// NewRecorder creates a new recorder and registers the Prometheus metrics.
+func NewRecorder(controller string, register bool, config ...RecorderConfig) *Recorder {
+	var cfg RecorderConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	cfg = cfg.withoutReservedExtraLabels()
+
 	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "info",
 		Help:      "Flagger version and mesh provider information",
-	}, []string{"version", "mesh_provider"})
+	}, append([]string{"version", "mesh_provider"}, cfg.extraLabelNames()...))
 
 	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Subsystem: controller,
 		Name:      "canary_duration_seconds",
 		Help:      "Seconds spent performing canary analysis.",
 		Buckets:   prometheus.DefBuckets,
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	total := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_total",
 		Help:      "Total number of canary object",
-	}, []string{"namespace"})
+	}, append([]string{"namespace"}, cfg.extraLabelNames()...))
 
 	// 0 - running, 1 - successful, 2 - failed
 	status := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_status",
 		Help:      "Last canary analysis result",
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	// see pkg/apis/flagger/v1beta1/status.go
 	phase := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_phase",
 		Help:      "Condition of a canary at the current time",
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	webhookConfirmRollout := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_webhook_confirm_rollout",
 		Help:      "greater than 0 if confirm_rollout webhook failed",
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	webhookConfirmTrafficIncrease := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_webhook_confirm_traffic_increase",
 		Help:      "greater than 0 if confirm_traffic_increase webhook failed",
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	webhookConfirmPromotion := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_webhook_confirm_promotion",
 		Help:      "greater than 0 if confirm_promotion webhook failed",
-	}, []string{"name", "namespace"})
+	}, cfg.canaryLabelNames("name", "namespace"))
 
 	weight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Subsystem: controller,
 		Name:      "canary_weight",
 		Help:      "The virtual service destination weight current value",
-	}, []string{"workload", "namespace"})
+	}, cfg.canaryLabelNames("workload", "namespace"))
+
+	iterations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: controller,
+		Name:      "canary_iteration_total",
+		Help:      "Number of canary analysis iterations",
+	}, cfg.canaryLabelNames("name", "namespace"))
+
+	metricCheck := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: controller,
+		Name:      "canary_metric_check",
+		Help:      "Outcome of each canary analysis metric check",
+	}, cfg.canaryLabelNames("name", "namespace", "metric", "result"))
+
+	rollback := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: controller,
+		Name:      "canary_rollback_total",
+		Help:      "Number of canary rollbacks, labeled by the reason they were triggered",
+	}, cfg.canaryLabelNames("name", "namespace", "reason"))
 
 	if register {
 		prometheus.MustRegister(info)
@@ -113,9 +177,12 @@ func NewRecorder(controller string, register bool) Recorder {
 		prometheus.MustRegister(webhookConfirmTrafficIncrease)
 		prometheus.MustRegister(webhookConfirmPromotion)
 		prometheus.MustRegister(weight)
+		prometheus.MustRegister(iterations)
+		prometheus.MustRegister(metricCheck)
+		prometheus.MustRegister(rollback)
 	}
 
-	return Recorder{
+	return &Recorder{
 		info:                          info,
 		duration:                      duration,
 		total:                         total,
@@ -125,22 +192,48 @@ func NewRecorder(controller string, register bool) Recorder {
 		webhookConfirmTrafficIncrease: webhookConfirmTrafficIncrease,
 		webhookConfirmPromotion:       webhookConfirmPromotion,
 		weight:                        weight,
+		iterations:                    iterations,
+		metricCheck:                   metricCheck,
+		rollback:                      rollback,
+		config:                        cfg,
+	}
+}
+
+// canaryLabelValues builds the WithLabelValues() argument list for a
+// per-canary metric: the given label values (sanitized against the
+// configured allowlist) followed by the static extra labels and the
+// optional kind/provider labels, in the same order NewRecorder declared them.
+func (cr *Recorder) canaryLabelValues(cd *flaggerv1.Canary, names []string, values ...string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = cr.config.sanitize(names[i], v)
+	}
+	out = append(out, cr.config.extraLabelValues()...)
+	if cr.config.LabelTargetKind {
+		out = append(out, cd.Spec.TargetRef.Kind)
+	}
+	if cr.config.LabelProvider {
+		out = append(out, cd.Spec.Provider)
 	}
+	return out
 }
 
 // SetInfo sets the version and mesh provider labels
 func (cr *Recorder) SetInfo(version string, meshProvider string) {
-	cr.info.WithLabelValues(version, meshProvider).Set(1)
+	values := append([]string{version, meshProvider}, cr.config.extraLabelValues()...)
+	cr.info.WithLabelValues(values...).Set(1)
 }
 
 // SetDuration sets the time spent in seconds performing canary analysis
 func (cr *Recorder) SetDuration(cd *flaggerv1.Canary, duration time.Duration) {
-	cr.duration.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Observe(duration.Seconds())
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.duration.WithLabelValues(values...).Observe(duration.Seconds())
 }
 
 // SetTotal sets the total number of canaries per namespace
 func (cr *Recorder) SetTotal(namespace string, total int) {
-	cr.total.WithLabelValues(namespace).Set(float64(total))
+	values := append([]string{namespace}, cr.config.extraLabelValues()...)
+	cr.total.WithLabelValues(values...).Set(float64(total))
 }
 
 // SetStatus sets the last known canary analysis status
@@ -154,22 +247,26 @@ func (cr *Recorder) SetStatus(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase)
 	default:
 		status = 1
 	}
-	cr.status.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(status))
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.status.WithLabelValues(values...).Set(float64(status))
 }
 
 //  sets the webhook status
 func (cr *Recorder) SetWebhookConfirmTrafficIncrease(cd *flaggerv1.Canary, status WebhookStatus) {
-	cr.webhookConfirmTrafficIncrease.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(status))
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.webhookConfirmTrafficIncrease.WithLabelValues(values...).Set(float64(status))
 }
 
 //  sets the webhook status
 func (cr *Recorder) SetWebhookConfirmRollout(cd *flaggerv1.Canary, status WebhookStatus) {
-	cr.webhookConfirmRollout.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(status))
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.webhookConfirmRollout.WithLabelValues(values...).Set(float64(status))
 }
 
 //  sets the webhook status
 func (cr *Recorder) SetWebhookConfirmPromotion(cd *flaggerv1.Canary, status WebhookStatus) {
-	cr.webhookConfirmPromotion.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(status))
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.webhookConfirmPromotion.WithLabelValues(values...).Set(float64(status))
 }
 
 // SetPhase sets the last known condition of a canary at the current time
@@ -215,11 +312,44 @@ func (cr *Recorder) SetPhase(cd *flaggerv1.Canary, phase flaggerv1.CanaryPhase)
 	default:
 		canaryPhase = Progressing
 	}
-	cr.phase.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(canaryPhase))
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.phase.WithLabelValues(values...).Set(float64(canaryPhase))
 }
 
 // SetWeight sets the weight values for primary and canary destinations
 func (cr *Recorder) SetWeight(cd *flaggerv1.Canary, primary int, canary int) {
-	cr.weight.WithLabelValues(fmt.Sprintf("%s-primary", cd.Spec.TargetRef.Name), cd.Namespace).Set(float64(primary))
-	cr.weight.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace).Set(float64(canary))
+	names := []string{"workload", "namespace"}
+	primaryValues := cr.canaryLabelValues(cd, names, fmt.Sprintf("%s-primary", cd.Spec.TargetRef.Name), cd.Namespace)
+	cr.weight.WithLabelValues(primaryValues...).Set(float64(primary))
+	canaryValues := cr.canaryLabelValues(cd, names, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.weight.WithLabelValues(canaryValues...).Set(float64(canary))
+}
+
+// IncCanaryIteration increments the number of analysis loops run for a
+// canary. Call once per pass of the canary controller's analysis loop.
+func (cr *Recorder) IncCanaryIteration(cd *flaggerv1.Canary) {
+	values := cr.canaryLabelValues(cd, []string{"name", "namespace"}, cd.Spec.TargetRef.Name, cd.Namespace)
+	cr.iterations.WithLabelValues(values...).Inc()
+}
+
+// IncMetricCheck records the outcome of a single metric-template check
+// performed during canary analysis. Call once per metric check the
+// canary controller runs, alongside the existing pass/fail decision.
+func (cr *Recorder) IncMetricCheck(cd *flaggerv1.Canary, metric string, pass bool) {
+	result := "pass"
+	if !pass {
+		result = "fail"
+	}
+	names := []string{"name", "namespace", "metric", "result"}
+	values := cr.canaryLabelValues(cd, names, cd.Spec.TargetRef.Name, cd.Namespace, metric, result)
+	cr.metricCheck.WithLabelValues(values...).Inc()
+}
+
+// IncRollback increments the number of rollbacks for a canary, labeled by
+// the reason the rollback was triggered. Call from the canary controller
+// wherever it currently transitions a canary to CanaryPhaseFailed.
+func (cr *Recorder) IncRollback(cd *flaggerv1.Canary, reason RollbackReason) {
+	names := []string{"name", "namespace", "reason"}
+	values := cr.canaryLabelValues(cd, names, cd.Spec.TargetRef.Name, cd.Namespace, string(reason))
+	cr.rollback.WithLabelValues(values...).Inc()
 }
@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// cardinalityFallback is recorded in place of a label value that fails its
+// configured allowlist, so a burst of unexpected values collapses into a
+// single series instead of one per value.
+const cardinalityFallback = "other"
+
+// reservedLabelNames are the label names a Recorder/OTelRecorder already
+// attaches to one or more metrics. ExtraLabels keys that collide with one of
+// these would register a duplicate label name on that metric, which panics
+// MustRegister on the Prometheus side and silently collapses attributes on
+// the OTel side.
+var reservedLabelNames = map[string]bool{
+	"name":          true,
+	"namespace":     true,
+	"workload":      true,
+	"metric":        true,
+	"result":        true,
+	"reason":        true,
+	"version":       true,
+	"mesh_provider": true,
+	"kind":          true,
+	"provider":      true,
+}
+
+// RecorderConfig customizes the labels a Recorder or OTelRecorder attaches to
+// every metric. It is accepted as an optional argument to NewRecorder and
+// NewOTelRecorder so existing callers that only pass the controller name and
+// the register flag keep working unchanged.
+type RecorderConfig struct {
+	// ExtraLabels are static key/value pairs stamped on every metric, e.g.
+	// cluster or region, so dashboards fed by several Flagger deployments
+	// can be told apart. Keys that collide with a built-in label name
+	// (see reservedLabelNames, e.g. mesh_provider) are dropped by
+	// NewRecorder and rejected with an error by NewOTelRecorder.
+	ExtraLabels map[string]string
+	// LabelTargetKind adds the canary's Spec.TargetRef.Kind as a "kind"
+	// label on the per-canary metrics.
+	LabelTargetKind bool
+	// LabelProvider adds the canary's Spec.Provider as a "provider" label
+	// on the per-canary metrics.
+	LabelProvider bool
+	// LabelValueAllowlist restricts the values recorded for a given label
+	// name on the per-canary metrics to those matching the regexp. Values
+	// that don't match are recorded as "other", which guards against
+	// cardinality explosions from generated canary or workload names. The
+	// labels of the info and canary_total metrics are not filtered.
+	LabelValueAllowlist map[string]*regexp.Regexp
+}
+
+// extraLabelNames returns the ExtraLabels keys in a stable order, so the
+// label names declared on a metric always line up with the values passed to
+// WithLabelValues/attribute.KeyValue.
+func (c RecorderConfig) extraLabelNames() []string {
+	names := make([]string, 0, len(c.ExtraLabels))
+	for name := range c.ExtraLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extraLabelValues returns the ExtraLabels values in the same order as
+// extraLabelNames.
+func (c RecorderConfig) extraLabelValues() []string {
+	names := c.extraLabelNames()
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = c.ExtraLabels[name]
+	}
+	return values
+}
+
+// canaryLabelNames appends the extra label names and then the optional
+// kind/provider label names to base, the metric-specific labels declared by
+// a per-canary metric (e.g. "name", "namespace").
+func (c RecorderConfig) canaryLabelNames(base ...string) []string {
+	names := append(append([]string{}, base...), c.extraLabelNames()...)
+	if c.LabelTargetKind {
+		names = append(names, "kind")
+	}
+	if c.LabelProvider {
+		names = append(names, "provider")
+	}
+	return names
+}
+
+// sanitize applies the LabelValueAllowlist to a label value, returning
+// cardinalityFallback if the label has an allowlist and value doesn't match it.
+func (c RecorderConfig) sanitize(name, value string) string {
+	if re, ok := c.LabelValueAllowlist[name]; ok && re != nil && !re.MatchString(value) {
+		return cardinalityFallback
+	}
+	return value
+}
+
+// validate rejects an ExtraLabels key that collides with a built-in label name.
+func (c RecorderConfig) validate() error {
+	for name := range c.ExtraLabels {
+		if reservedLabelNames[name] {
+			return fmt.Errorf("metrics: ExtraLabels key %q collides with a built-in label name", name)
+		}
+	}
+	return nil
+}
+
+// withoutReservedExtraLabels returns a copy of c with any ExtraLabels keys
+// that collide with a built-in label name removed, so a misconfigured
+// ExtraLabels can't register a metric with a duplicate label name.
+func (c RecorderConfig) withoutReservedExtraLabels() RecorderConfig {
+	if len(c.ExtraLabels) == 0 {
+		return c
+	}
+	filtered := make(map[string]string, len(c.ExtraLabels))
+	for name, value := range c.ExtraLabels {
+		if !reservedLabelNames[name] {
+			filtered[name] = value
+		}
+	}
+	c.ExtraLabels = filtered
+	return c
+}
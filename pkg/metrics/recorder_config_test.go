@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRecorderConfigExtraLabelNamesAndValuesAreAligned(t *testing.T) {
+	cfg := RecorderConfig{ExtraLabels: map[string]string{"region": "eu", "cluster": "a"}}
+
+	names := cfg.extraLabelNames()
+	values := cfg.extraLabelValues()
+
+	wantNames := []string{"cluster", "region"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("extraLabelNames() = %v, want %v", names, wantNames)
+	}
+	for i, name := range names {
+		if values[i] != cfg.ExtraLabels[name] {
+			t.Errorf("extraLabelValues()[%d] = %q, want value for %q", i, values[i], name)
+		}
+	}
+}
+
+func TestRecorderConfigCanaryLabelNames(t *testing.T) {
+	cfg := RecorderConfig{
+		ExtraLabels:     map[string]string{"region": "eu"},
+		LabelTargetKind: true,
+		LabelProvider:   true,
+	}
+
+	got := cfg.canaryLabelNames("name", "namespace")
+	want := []string{"name", "namespace", "region", "kind", "provider"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("canaryLabelNames() = %v, want %v", got, want)
+	}
+}
+
+func TestRecorderConfigSanitize(t *testing.T) {
+	cfg := RecorderConfig{LabelValueAllowlist: map[string]*regexp.Regexp{
+		"namespace": regexp.MustCompile(`^prod-`),
+	}}
+
+	if got := cfg.sanitize("namespace", "prod-a"); got != "prod-a" {
+		t.Errorf("sanitize(matching) = %q, want unchanged value", got)
+	}
+	if got := cfg.sanitize("namespace", "dev-a"); got != cardinalityFallback {
+		t.Errorf("sanitize(non-matching) = %q, want %q", got, cardinalityFallback)
+	}
+	if got := cfg.sanitize("name", "anything"); got != "anything" {
+		t.Errorf("sanitize(no allowlist) = %q, want unchanged value", got)
+	}
+}
+
+func TestRecorderConfigValidateRejectsReservedExtraLabel(t *testing.T) {
+	cfg := RecorderConfig{ExtraLabels: map[string]string{"mesh_provider": "istio"}}
+
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() = nil, want error for ExtraLabels colliding with a built-in label")
+	}
+}
+
+func TestRecorderConfigValidateAllowsDistinctExtraLabel(t *testing.T) {
+	cfg := RecorderConfig{ExtraLabels: map[string]string{"region": "eu"}}
+
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() = %v, want nil", err)
+	}
+}
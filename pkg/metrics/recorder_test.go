@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	flaggerv1 "github.com/fluxcd/flagger/pkg/apis/flagger/v1beta1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	hpav2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testCanary() *flaggerv1.Canary {
+	return &flaggerv1.Canary{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "test"},
+		Spec: flaggerv1.CanarySpec{
+			TargetRef: hpav2.CrossVersionObjectReference{Kind: "Deployment", Name: "podinfo"},
+			Provider:  "istio",
+		},
+	}
+}
+
+func TestRecorderIncCanaryIteration(t *testing.T) {
+	rec := NewRecorder("test_inc_iteration", false)
+	cd := testCanary()
+
+	rec.IncCanaryIteration(cd)
+	rec.IncCanaryIteration(cd)
+
+	got := testutil.ToFloat64(rec.iterations.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace))
+	if got != 2 {
+		t.Errorf("canary_iteration_total = %v, want 2", got)
+	}
+}
+
+func TestRecorderIncMetricCheck(t *testing.T) {
+	rec := NewRecorder("test_inc_metric_check", false)
+	cd := testCanary()
+
+	rec.IncMetricCheck(cd, "request-success-rate", true)
+	rec.IncMetricCheck(cd, "request-success-rate", false)
+
+	pass := testutil.ToFloat64(rec.metricCheck.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace, "request-success-rate", "pass"))
+	fail := testutil.ToFloat64(rec.metricCheck.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace, "request-success-rate", "fail"))
+	if pass != 1 || fail != 1 {
+		t.Errorf("canary_metric_check pass=%v fail=%v, want 1 and 1", pass, fail)
+	}
+}
+
+func TestRecorderIncRollback(t *testing.T) {
+	rec := NewRecorder("test_inc_rollback", false)
+	cd := testCanary()
+
+	rec.IncRollback(cd, RollbackReasonWebhookFailed)
+
+	got := testutil.ToFloat64(rec.rollback.WithLabelValues(cd.Spec.TargetRef.Name, cd.Namespace, string(RollbackReasonWebhookFailed)))
+	if got != 1 {
+		t.Errorf("canary_rollback_total{reason=webhook_failed} = %v, want 1", got)
+	}
+}
+
+func TestNewRecorderDropsCollidingExtraLabel(t *testing.T) {
+	rec := NewRecorder("test", false, RecorderConfig{
+		ExtraLabels: map[string]string{"mesh_provider": "istio", "region": "eu"},
+	})
+
+	if _, ok := rec.config.ExtraLabels["mesh_provider"]; ok {
+		t.Error("mesh_provider should have been dropped, it collides with the info gauge's own label")
+	}
+	if rec.config.ExtraLabels["region"] != "eu" {
+		t.Error("region should have been kept, it doesn't collide with any built-in label")
+	}
+}